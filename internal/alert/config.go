@@ -0,0 +1,88 @@
+package alert
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the shape of the -alerts file: the rules to watch, how long to
+// wait before re-alerting on a rule that's still breached, and the
+// notifiers to deliver alerts through.
+type Config struct {
+	MinInterval Duration        `yaml:"alert_min_interval" json:"alert_min_interval"`
+	Rules       []Rule          `yaml:"rules" json:"rules"`
+	SMTP        *SMTPConfig     `yaml:"smtp,omitempty" json:"smtp,omitempty"`
+	Webhooks    []WebhookConfig `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+	Twilio      *TwilioConfig   `yaml:"twilio,omitempty" json:"twilio,omitempty"`
+}
+
+// Duration wraps time.Duration so -alerts files can spell out durations
+// like "5m" rather than a raw count of nanoseconds.
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalYAML implements the function-based (yaml.v2 style) unmarshaler
+// interface, which yaml.v3 still honors alongside its node-based
+// yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// LoadConfig reads and parses the -alerts file at path. Paths ending in
+// ".yaml" or ".yml" are parsed as YAML; everything else is parsed as JSON.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		err = yaml.Unmarshal(data, &cfg)
+	} else {
+		err = json.Unmarshal(data, &cfg)
+	}
+	return cfg, err
+}
+
+// BuildNotifiers constructs the Notifier set described by cfg.
+func BuildNotifiers(cfg Config) []Notifier {
+	var notifiers []Notifier
+	if cfg.SMTP != nil {
+		notifiers = append(notifiers, NewSMTPNotifier(*cfg.SMTP))
+	}
+	for _, wh := range cfg.Webhooks {
+		notifiers = append(notifiers, NewWebhookNotifier(wh))
+	}
+	if cfg.Twilio != nil {
+		notifiers = append(notifiers, NewTwilioNotifier(*cfg.Twilio))
+	}
+	return notifiers
+}
@@ -0,0 +1,116 @@
+// Package alert watches the stream of completed speed test results for SLA
+// violations and fires notifications through pluggable Notifiers (email,
+// webhook, SMS, ...) when a rule's threshold is breached for enough
+// consecutive tests. A minimum re-alert interval keeps a rule that stays
+// breached from flapping the same notifiers every test; alerts suppressed
+// during that window are folded into a "N more since last alert" note on
+// the next one that's actually sent.
+package alert
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// Notifier delivers a fired Alert somewhere outside netmon: an email, a
+// webhook POST, an SMS, etc.
+type Notifier interface {
+	Notify(a messages.Alert) error
+}
+
+// ruleState tracks a single Rule's running breach count and the last time
+// it fired, so Engine can require N consecutive breaches before alerting
+// and suppress re-alerts within the configured MinInterval.
+type ruleState struct {
+	consecutive int
+	lastAlert   time.Time
+	suppressed  int
+}
+
+// Engine evaluates a Config's rules against a stream of speed test results
+// and delivers breaches through every configured Notifier.
+type Engine struct {
+	mtx       sync.Mutex
+	cfg       Config
+	notifiers []Notifier
+	state     map[string]*ruleState
+}
+
+// NewEngine creates an Engine that evaluates cfg's rules and delivers
+// breaches through notifiers.
+func NewEngine(cfg Config, notifiers []Notifier) *Engine {
+	return &Engine{cfg: cfg, notifiers: notifiers, state: make(map[string]*ruleState)}
+}
+
+// Reload atomically swaps in a new Config and Notifier set, for picking up
+// edits to the -alerts file on SIGHUP without restarting netmon. Per-rule
+// breach counters are reset, since the new rule set may not line up with
+// the old one.
+func (e *Engine) Reload(cfg Config, notifiers []Notifier) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	e.cfg = cfg
+	e.notifiers = notifiers
+	e.state = make(map[string]*ruleState)
+}
+
+// Observe evaluates every configured rule against perf, the latest test
+// result (testErr is non-nil if the test itself failed rather than
+// producing a result). For each rule that newly breaches its threshold for
+// the required number of consecutive tests, Observe delivers a
+// messages.Alert through every configured Notifier and includes it in the
+// returned slice, so the caller can also broadcast it (e.g. over the
+// WebSocket). A Notifier error doesn't stop delivery to the remaining
+// notifiers; all such errors are collected and returned instead.
+func (e *Engine) Observe(perf messages.PerfJSON, testErr error) ([]messages.Alert, []error) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	var fired []messages.Alert
+	var errs []error
+	for _, rule := range e.cfg.Rules {
+		breached, detail := rule.evaluate(perf, testErr)
+
+		st := e.state[rule.Name]
+		if st == nil {
+			st = &ruleState{}
+			e.state[rule.Name] = st
+		}
+		if !breached {
+			st.consecutive = 0
+			continue
+		}
+		st.consecutive++
+
+		need := rule.Consecutive
+		if need <= 0 {
+			need = 1
+		}
+		if st.consecutive < need {
+			continue
+		}
+		if !st.lastAlert.IsZero() && time.Since(st.lastAlert) < e.cfg.MinInterval.Duration {
+			st.suppressed++
+			continue
+		}
+
+		msg := fmt.Sprintf("%s: %s", rule.Name, detail)
+		if st.suppressed > 0 {
+			msg = fmt.Sprintf("%s (%d more since last alert)", msg, st.suppressed)
+		}
+		a := messages.Alert{Rule: rule.Name, Message: msg, Result: perf, Timestamp: time.Now()}
+		st.lastAlert = a.Timestamp
+		st.suppressed = 0
+
+		for _, n := range e.notifiers {
+			if err := n.Notify(a); err != nil {
+				errs = append(errs, fmt.Errorf("rule %q: %w", rule.Name, err))
+			}
+		}
+		fired = append(fired, a)
+	}
+	return fired, errs
+}
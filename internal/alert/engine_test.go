@@ -0,0 +1,139 @@
+package alert
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// fakeNotifier records every Alert it's given and can be made to fail.
+type fakeNotifier struct {
+	fail   bool
+	alerts []messages.Alert
+}
+
+func (f *fakeNotifier) Notify(a messages.Alert) error {
+	if f.fail {
+		return errors.New("notify failed")
+	}
+	f.alerts = append(f.alerts, a)
+	return nil
+}
+
+func belowRule(name string, threshold float64, consecutive int) Rule {
+	t := threshold
+	return Rule{Name: name, Metric: MetricDownload, Below: &t, Consecutive: consecutive}
+}
+
+func perfWithDownload(mbps float64) messages.PerfJSON {
+	var p messages.PerfJSON
+	p.Download = mbps * 1e6
+	return p
+}
+
+func TestEngineObserveRequiresConsecutiveBreaches(t *testing.T) {
+	notifier := &fakeNotifier{}
+	e := NewEngine(Config{Rules: []Rule{belowRule("slow-download", 50, 3)}}, []Notifier{notifier})
+
+	breach := perfWithDownload(10)
+	ok := perfWithDownload(100)
+
+	for i := 0; i < 2; i++ {
+		fired, errs := e.Observe(breach, nil)
+		if len(fired) != 0 || len(errs) != 0 {
+			t.Fatalf("breach %d: got fired=%v errs=%v, want none before Consecutive is reached", i+1, fired, errs)
+		}
+	}
+
+	fired, errs := e.Observe(breach, nil)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(fired) != 1 {
+		t.Fatalf("got %d alerts on the 3rd consecutive breach, want 1", len(fired))
+	}
+	if len(notifier.alerts) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(notifier.alerts))
+	}
+
+	// A non-breaching result resets the counter, so it takes another 3
+	// consecutive breaches to alert again.
+	e.Observe(ok, nil)
+	fired, _ = e.Observe(breach, nil)
+	if len(fired) != 0 {
+		t.Fatalf("got %d alerts right after the counter reset, want 0", len(fired))
+	}
+}
+
+func TestEngineObserveSuppressesWithinMinInterval(t *testing.T) {
+	notifier := &fakeNotifier{}
+	cfg := Config{
+		Rules:       []Rule{belowRule("slow-download", 50, 1)},
+		MinInterval: Duration{time.Hour},
+	}
+	e := NewEngine(cfg, []Notifier{notifier})
+
+	breach := perfWithDownload(10)
+
+	fired, _ := e.Observe(breach, nil)
+	if len(fired) != 1 {
+		t.Fatalf("got %d alerts on first breach, want 1", len(fired))
+	}
+
+	for i := 0; i < 2; i++ {
+		fired, _ = e.Observe(breach, nil)
+		if len(fired) != 0 {
+			t.Fatalf("breach suppressed within MinInterval still fired: %v", fired)
+		}
+	}
+
+	// Force the window to have elapsed so the next breach fires again, and
+	// carries the suppressed count forward in its message.
+	e.state["slow-download"].lastAlert = time.Now().Add(-2 * time.Hour)
+	fired, _ = e.Observe(breach, nil)
+	if len(fired) != 1 {
+		t.Fatalf("got %d alerts after MinInterval elapsed, want 1", len(fired))
+	}
+	if want := "more since last alert"; !strings.Contains(fired[0].Message, want) {
+		t.Errorf("message %q doesn't mention suppressed count (want substring %q)", fired[0].Message, want)
+	}
+}
+
+func TestEngineObserveCollectsNotifierErrors(t *testing.T) {
+	notifier := &fakeNotifier{fail: true}
+	e := NewEngine(Config{Rules: []Rule{belowRule("slow-download", 50, 1)}}, []Notifier{notifier})
+
+	fired, errs := e.Observe(perfWithDownload(10), nil)
+	if len(fired) != 1 {
+		t.Fatalf("got %d alerts, want 1 (a failing notifier shouldn't stop delivery)", len(fired))
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got %d errors, want 1", len(errs))
+	}
+}
+
+func TestEngineReloadResetsState(t *testing.T) {
+	notifier := &fakeNotifier{}
+	rule := belowRule("slow-download", 50, 2)
+	e := NewEngine(Config{Rules: []Rule{rule}}, []Notifier{notifier})
+
+	e.Observe(perfWithDownload(10), nil)
+	if e.state["slow-download"].consecutive != 1 {
+		t.Fatalf("consecutive = %d before reload, want 1", e.state["slow-download"].consecutive)
+	}
+
+	e.Reload(Config{Rules: []Rule{rule}}, []Notifier{notifier})
+
+	if st := e.state["slow-download"]; st != nil {
+		t.Fatalf("state %+v survived Reload, want a clean map", st)
+	}
+
+	// After reload it again takes the full Consecutive count to fire.
+	fired, _ := e.Observe(perfWithDownload(10), nil)
+	if len(fired) != 0 {
+		t.Fatalf("got %d alerts on first breach after reload, want 0", len(fired))
+	}
+}
@@ -0,0 +1,66 @@
+package alert
+
+import (
+	"fmt"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// The metrics a Rule can watch. MetricFailure matches a test that errored
+// out, rather than comparing a threshold against a completed result.
+const (
+	MetricDownload = "download"
+	MetricUpload   = "upload"
+	MetricPing     = "ping"
+	MetricFailure  = "failure"
+)
+
+// Rule describes a single SLA threshold to watch the stream of speed test
+// results for. Exactly one of Below/Above is meaningful for Metric values
+// other than MetricFailure; Consecutive is how many tests in a row must
+// breach the threshold before Engine alerts (default 1).
+type Rule struct {
+	Name        string   `yaml:"name" json:"name"`
+	Metric      string   `yaml:"metric" json:"metric"`
+	Below       *float64 `yaml:"below,omitempty" json:"below,omitempty"`
+	Above       *float64 `yaml:"above,omitempty" json:"above,omitempty"`
+	Consecutive int      `yaml:"consecutive,omitempty" json:"consecutive,omitempty"`
+}
+
+// evaluate reports whether perf (or testErr, for MetricFailure) breaches r,
+// along with a human-readable description of the breach to use in the
+// alert message.
+func (r Rule) evaluate(perf messages.PerfJSON, testErr error) (bool, string) {
+	if r.Metric == MetricFailure {
+		if testErr != nil {
+			return true, fmt.Sprintf("test failed: %s", testErr.Error())
+		}
+		return false, ""
+	}
+	if testErr != nil {
+		// Nothing to compare a threshold against if the test itself failed.
+		return false, ""
+	}
+
+	var value float64
+	var unit string
+	switch r.Metric {
+	case MetricDownload:
+		value, unit = perf.Download/1e6, "Mb/s"
+	case MetricUpload:
+		value, unit = perf.Upload/1e6, "Mb/s"
+	case MetricPing:
+		value, unit = perf.Ping, "ms"
+	default:
+		return false, ""
+	}
+
+	switch {
+	case r.Below != nil && value < *r.Below:
+		return true, fmt.Sprintf("%s %.2f %s is below threshold %.2f %s", r.Metric, value, unit, *r.Below, unit)
+	case r.Above != nil && value > *r.Above:
+		return true, fmt.Sprintf("%s %.2f %s is above threshold %.2f %s", r.Metric, value, unit, *r.Above, unit)
+	default:
+		return false, ""
+	}
+}
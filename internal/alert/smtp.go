@@ -0,0 +1,42 @@
+package alert
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// SMTPConfig configures SMTPNotifier.
+type SMTPConfig struct {
+	Host       string   `yaml:"host" json:"host"`
+	Port       int      `yaml:"port" json:"port"`
+	Username   string   `yaml:"username,omitempty" json:"username,omitempty"`
+	Password   string   `yaml:"password,omitempty" json:"password,omitempty"`
+	From       string   `yaml:"from" json:"from"`
+	Recipients []string `yaml:"recipients" json:"recipients"`
+}
+
+// SMTPNotifier delivers alerts as plain-text email via an SMTP server.
+type SMTPNotifier struct {
+	cfg SMTPConfig
+}
+
+// NewSMTPNotifier creates a Notifier that emails cfg.Recipients through
+// cfg's SMTP server.
+func NewSMTPNotifier(cfg SMTPConfig) *SMTPNotifier {
+	return &SMTPNotifier{cfg: cfg}
+}
+
+// Notify implements Notifier.
+func (n *SMTPNotifier) Notify(a messages.Alert) error {
+	addr := fmt.Sprintf("%s:%d", n.cfg.Host, n.cfg.Port)
+	var auth smtp.Auth
+	if n.cfg.Username != "" {
+		auth = smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)
+	}
+	msg := fmt.Sprintf("To: %s\r\nFrom: %s\r\nSubject: netmon alert: %s\r\n\r\n%s\r\n",
+		strings.Join(n.cfg.Recipients, ", "), n.cfg.From, a.Rule, a.Message)
+	return smtp.SendMail(addr, auth, n.cfg.From, n.cfg.Recipients, []byte(msg))
+}
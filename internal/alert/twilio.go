@@ -0,0 +1,67 @@
+package alert
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// twilioTimeout bounds how long a single Twilio API call is allowed to
+// take.
+const twilioTimeout = 10 * time.Second
+
+// twilioAPIBase is the Twilio REST API root used to send SMS messages.
+const twilioAPIBase = "https://api.twilio.com/2010-04-01/Accounts"
+
+// TwilioConfig configures TwilioNotifier to send SMS via the Twilio REST
+// API.
+type TwilioConfig struct {
+	SID   string   `yaml:"sid" json:"sid"`
+	Token string   `yaml:"token" json:"token"`
+	From  string   `yaml:"from" json:"from"`
+	To    []string `yaml:"to" json:"to"`
+}
+
+// TwilioNotifier delivers alerts as SMS messages via Twilio.
+type TwilioNotifier struct {
+	cfg    TwilioConfig
+	client *http.Client
+}
+
+// NewTwilioNotifier creates a Notifier that sends an SMS to every number in
+// cfg.To via the Twilio account identified by cfg.SID/cfg.Token.
+func NewTwilioNotifier(cfg TwilioConfig) *TwilioNotifier {
+	return &TwilioNotifier{cfg: cfg, client: &http.Client{Timeout: twilioTimeout}}
+}
+
+// Notify implements Notifier.
+func (n *TwilioNotifier) Notify(a messages.Alert) error {
+	endpoint := fmt.Sprintf("%s/%s/Messages.json", twilioAPIBase, n.cfg.SID)
+	for _, to := range n.cfg.To {
+		form := url.Values{}
+		form.Set("From", n.cfg.From)
+		form.Set("To", to)
+		form.Set("Body", fmt.Sprintf("netmon alert: %s", a.Message))
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(n.cfg.SID, n.cfg.Token)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("twilio sms to %s returned status %d", to, resp.StatusCode)
+		}
+	}
+	return nil
+}
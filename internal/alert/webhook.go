@@ -0,0 +1,58 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// webhookTimeout bounds how long a single webhook POST is allowed to take.
+const webhookTimeout = 10 * time.Second
+
+// WebhookConfig configures WebhookNotifier.
+type WebhookConfig struct {
+	URL     string            `yaml:"url" json:"url"`
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+}
+
+// WebhookNotifier delivers alerts by POSTing the offending messages.Alert
+// as JSON to a configured URL.
+type WebhookNotifier struct {
+	cfg    WebhookConfig
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a Notifier that POSTs to cfg.URL.
+func NewWebhookNotifier(cfg WebhookConfig) *WebhookNotifier {
+	return &WebhookNotifier{cfg: cfg, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Notify implements Notifier.
+func (n *WebhookNotifier) Notify(a messages.Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, n.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %d", n.cfg.URL, resp.StatusCode)
+	}
+	return nil
+}
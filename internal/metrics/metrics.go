@@ -0,0 +1,99 @@
+// Package metrics exposes netmon's internal state as Prometheus metrics,
+// served over HTTP in the standard exposition format.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// Metrics holds the Prometheus collectors netmon reports through /metrics.
+type Metrics struct {
+	registry     *prometheus.Registry
+	download     *prometheus.GaugeVec
+	upload       *prometheus.GaugeVec
+	ping         *prometheus.GaugeVec
+	distance     *prometheus.GaugeVec
+	testsTotal   *prometheus.CounterVec
+	wsClients    prometheus.Gauge
+	testDuration prometheus.Histogram
+}
+
+// New creates a Metrics with all of netmon's collectors registered against
+// a fresh registry.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		download: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netmon_download_mbps",
+			Help: "Most recently measured download throughput, in Mb/s.",
+		}, []string{"server_id", "sponsor"}),
+		upload: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netmon_upload_mbps",
+			Help: "Most recently measured upload throughput, in Mb/s.",
+		}, []string{"server_id", "sponsor"}),
+		ping: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netmon_ping_ms",
+			Help: "Most recently measured ping latency, in milliseconds.",
+		}, []string{"server_id", "sponsor"}),
+		distance: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "netmon_distance_km",
+			Help: "Distance to the speed test server, in kilometers.",
+		}, []string{"server_id", "sponsor"}),
+		testsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "netmon_tests_total",
+			Help: "Total number of speed tests run, labeled by result.",
+		}, []string{"result"}),
+		wsClients: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "netmon_ws_clients",
+			Help: "Number of currently connected WebSocket clients.",
+		}),
+		testDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "netmon_test_duration_seconds",
+			Help:    "How long a speed test took to complete, in seconds.",
+			Buckets: prometheus.DefBuckets,
+		}),
+	}
+	m.registry.MustRegister(m.download, m.upload, m.ping, m.distance, m.testsTotal, m.wsClients, m.testDuration)
+	return m
+}
+
+// ObserveResult records a completed speed test's throughput, latency, and
+// distance, and counts it towards netmon_tests_total{result="ok"}.
+func (m *Metrics) ObserveResult(perf messages.PerfJSON, duration time.Duration) {
+	labels := prometheus.Labels{"server_id": perf.Server.ID, "sponsor": perf.Server.Sponsor}
+	m.download.With(labels).Set(perf.Download / 1e6)
+	m.upload.With(labels).Set(perf.Upload / 1e6)
+	m.ping.With(labels).Set(perf.Ping)
+	m.distance.With(labels).Set(perf.Server.Distance)
+	m.testsTotal.WithLabelValues("ok").Inc()
+	m.testDuration.Observe(duration.Seconds())
+}
+
+// ObserveFailure counts a speed test that errored out instead of producing
+// a result towards netmon_tests_total{result="error"}.
+func (m *Metrics) ObserveFailure(duration time.Duration) {
+	m.testsTotal.WithLabelValues("error").Inc()
+	m.testDuration.Observe(duration.Seconds())
+}
+
+// IncWSClients reports that a WebSocket client connected.
+func (m *Metrics) IncWSClients() {
+	m.wsClients.Inc()
+}
+
+// DecWSClients reports that a WebSocket client disconnected.
+func (m *Metrics) DecWSClients() {
+	m.wsClients.Dec()
+}
+
+// Handler returns the http.Handler that serves m's collectors in the
+// Prometheus exposition format, for mounting on a -metrics-addr server.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
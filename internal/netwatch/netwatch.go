@@ -0,0 +1,44 @@
+// Package netwatch watches the local machine's network interfaces and
+// addresses for changes and reports them as a stream of Events.
+//
+// On Linux, events are delivered as they happen via an AF_NETLINK/
+// NETLINK_ROUTE socket. On other platforms, a portable fallback polls
+// net.Interfaces() every few seconds and diffs successive snapshots. Both
+// implementations are exposed through the same Watch function.
+package netwatch
+
+import (
+	"context"
+	"time"
+)
+
+// Kind identifies the type of network change an Event describes.
+type Kind string
+
+// The kinds of changes netwatch reports.
+const (
+	InterfaceUp   Kind = "interface_up"
+	InterfaceDown Kind = "interface_down"
+	AddrAdded     Kind = "addr_added"
+	AddrRemoved   Kind = "addr_removed"
+)
+
+// Event describes a single interface or address change. Addr is only
+// populated for AddrAdded and AddrRemoved events.
+type Event struct {
+	Iface     string
+	Kind      Kind
+	Addr      string
+	Timestamp time.Time
+}
+
+// Watch starts watching the local network interfaces and addresses for
+// changes. It returns a channel of Events that is closed once ctx is
+// cancelled or the underlying watch fails. On Linux, cancellation is only
+// noticed after the blocking read of the next netlink message returns, so
+// the channel is closed then rather than at the moment ctx is cancelled.
+// The concrete implementation (netlink-based or polling) is selected per
+// platform by build tags.
+func Watch(ctx context.Context) (<-chan Event, error) {
+	return watch(ctx)
+}
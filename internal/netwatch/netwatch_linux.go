@@ -0,0 +1,164 @@
+//go:build linux
+
+package netwatch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// rtnlGroup computes the multicast group bit for an RTNLGRP_* constant, the
+// same way the kernel documents doing it in rtnetlink(7): bit (group - 1).
+func rtnlGroup(group uint32) uint32 {
+	return 1 << (group - 1)
+}
+
+// The RTNLGRP_* multicast group numbers netwatch subscribes to. These
+// aren't exposed by the standard library's syscall package, so they're
+// hand-copied from <linux/rtnetlink.h>.
+const (
+	rtnlGrpLink       = 1
+	rtnlGrpIPv4IfAddr = 5
+	rtnlGrpIPv6IfAddr = 9
+)
+
+// watch opens an AF_NETLINK/NETLINK_ROUTE socket subscribed to link and
+// address change groups and translates the messages it receives into
+// Events.
+func watch(ctx context.Context) (<-chan Event, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("netwatch: socket: %w", err)
+	}
+
+	groups := rtnlGroup(rtnlGrpLink) | rtnlGroup(rtnlGrpIPv4IfAddr) | rtnlGroup(rtnlGrpIPv6IfAddr)
+	sa := &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: groups}
+	if err := syscall.Bind(fd, sa); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("netwatch: bind: %w", err)
+	}
+
+	events := make(chan Event)
+	go readLoop(ctx, fd, events)
+	return events, nil
+}
+
+// readLoop reads netlink messages from fd until ctx is cancelled, decoding
+// each into zero or more Events and sending them on events.
+func readLoop(ctx context.Context, fd int, events chan<- Event) {
+	defer close(events)
+	defer syscall.Close(fd)
+
+	buf := make([]byte, 8192)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, ev := range toEvents(msgs) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// toEvents converts a batch of raw netlink messages into Events, ignoring
+// any message types netwatch doesn't care about.
+func toEvents(msgs []syscall.NetlinkMessage) []Event {
+	var out []Event
+	now := time.Now()
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+			if ev, ok := linkEvent(m, now); ok {
+				out = append(out, ev)
+			}
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+			if ev, ok := addrEvent(m, now); ok {
+				out = append(out, ev)
+			}
+		}
+	}
+	return out
+}
+
+// linkEvent decodes an RTM_NEWLINK/RTM_DELLINK message into an
+// InterfaceUp/InterfaceDown Event.
+func linkEvent(m syscall.NetlinkMessage, now time.Time) (Event, bool) {
+	if len(m.Data) < syscall.SizeofIfInfomsg {
+		return Event{}, false
+	}
+	ifim := *(*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+	if err != nil {
+		return Event{}, false
+	}
+
+	name := ifaceName(int(ifim.Index))
+	for _, a := range attrs {
+		if a.Attr.Type == syscall.IFLA_IFNAME {
+			name = strings.TrimRight(string(a.Value), "\x00")
+		}
+	}
+
+	kind := InterfaceDown
+	if m.Header.Type == syscall.RTM_NEWLINK && ifim.Flags&syscall.IFF_UP != 0 {
+		kind = InterfaceUp
+	}
+	return Event{Iface: name, Kind: kind, Timestamp: now}, true
+}
+
+// addrEvent decodes an RTM_NEWADDR/RTM_DELADDR message into an
+// AddrAdded/AddrRemoved Event.
+func addrEvent(m syscall.NetlinkMessage, now time.Time) (Event, bool) {
+	if len(m.Data) < syscall.SizeofIfAddrmsg {
+		return Event{}, false
+	}
+	ifam := *(*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+	attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+	if err != nil {
+		return Event{}, false
+	}
+
+	var addr string
+	for _, a := range attrs {
+		if a.Attr.Type == syscall.IFA_ADDRESS || a.Attr.Type == syscall.IFA_LOCAL {
+			addr = fmt.Sprintf("%s/%d", net.IP(a.Value).String(), ifam.Prefixlen)
+		}
+	}
+
+	kind := AddrRemoved
+	if m.Header.Type == syscall.RTM_NEWADDR {
+		kind = AddrAdded
+	}
+	return Event{Iface: ifaceName(int(ifam.Index)), Kind: kind, Addr: addr, Timestamp: now}, true
+}
+
+// ifaceName resolves an interface index to its name, returning an empty
+// string if the interface can no longer be looked up (e.g. it was just
+// removed).
+func ifaceName(index int) string {
+	iface, err := net.InterfaceByIndex(index)
+	if err != nil {
+		return ""
+	}
+	return iface.Name
+}
@@ -0,0 +1,113 @@
+//go:build !linux
+
+package netwatch
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// pollInterval is how often the portable fallback re-checks
+// net.Interfaces() for changes.
+const pollInterval = 5 * time.Second
+
+// ifaceState is a snapshot of a single interface's up/down state and
+// addresses, used to diff successive polls.
+type ifaceState struct {
+	up    bool
+	addrs map[string]bool
+}
+
+// watch polls net.Interfaces() every pollInterval and diffs successive
+// snapshots to synthesize the same Events the Linux netlink watcher
+// produces natively.
+func watch(ctx context.Context) (<-chan Event, error) {
+	events := make(chan Event)
+	go pollLoop(ctx, events)
+	return events, nil
+}
+
+func pollLoop(ctx context.Context, events chan<- Event) {
+	defer close(events)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	prev := snapshot()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cur := snapshot()
+		for _, ev := range diff(prev, cur) {
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		prev = cur
+	}
+}
+
+// snapshot captures the current up/down state and address set of every
+// local interface.
+func snapshot() map[string]ifaceState {
+	states := make(map[string]ifaceState)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return states
+	}
+	for _, iface := range ifaces {
+		addrs := make(map[string]bool)
+		if addrList, err := iface.Addrs(); err == nil {
+			for _, a := range addrList {
+				addrs[a.String()] = true
+			}
+		}
+		states[iface.Name] = ifaceState{up: iface.Flags&net.FlagUp != 0, addrs: addrs}
+	}
+	return states
+}
+
+// diff compares two snapshots and produces the Events needed to explain how
+// prev became cur.
+func diff(prev, cur map[string]ifaceState) []Event {
+	var out []Event
+	now := time.Now()
+
+	for name, cs := range cur {
+		ps, existed := prev[name]
+		switch {
+		case cs.up && (!existed || !ps.up):
+			out = append(out, Event{Iface: name, Kind: InterfaceUp, Timestamp: now})
+		case !cs.up && (!existed || ps.up):
+			out = append(out, Event{Iface: name, Kind: InterfaceDown, Timestamp: now})
+		}
+
+		for addr := range cs.addrs {
+			if existed && ps.addrs[addr] {
+				continue
+			}
+			out = append(out, Event{Iface: name, Kind: AddrAdded, Addr: addr, Timestamp: now})
+		}
+		if existed {
+			for addr := range ps.addrs {
+				if !cs.addrs[addr] {
+					out = append(out, Event{Iface: name, Kind: AddrRemoved, Addr: addr, Timestamp: now})
+				}
+			}
+		}
+	}
+
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			out = append(out, Event{Iface: name, Kind: InterfaceDown, Timestamp: now})
+		}
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+// Package rpc implements a small JSON-RPC 2.0 layer for netmon's control
+// API. It is transport-agnostic: the same Mux processes a request whether
+// it arrived as a frame on the /ws WebSocket or as a POST body to the HTTP
+// /rpc endpoint, and legacy plain-string WebSocket frames (e.g.
+// "Start-CLI") can still be told apart from JSON-RPC ones with
+// LooksLikeRequest.
+package rpc
+
+import "encoding/json"
+
+// Version is the JSON-RPC protocol version netmon speaks.
+const Version = "2.0"
+
+// Standard JSON-RPC 2.0 error codes, plus netmon-specific ones in the
+// reserved -32000 to -32099 "server error" range.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+
+	CodeTestAlreadyRunning = -32001
+	CodeSpeedtestMissing   = -32002
+)
+
+// Request is a single JSON-RPC 2.0 request object. A Request with no ID is
+// a notification: no Response should be sent back for it.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// IsNotification reports whether r is a notification.
+func (r Request) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+// Response is a single JSON-RPC 2.0 response object, used for both
+// successful results and errors.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Error is a JSON-RPC 2.0 error object, and also implements Go's error
+// interface so it can be returned from method implementations directly.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Error implements the error interface for Error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Notification is a server-pushed JSON-RPC 2.0 notification: a method call
+// with no id and so no expected reply. netmon uses these for the "status",
+// "result", "netevent", and "alert" topics that netmon.subscribe clients
+// receive.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// NewNotification builds a Notification for the given method and params.
+func NewNotification(method string, params interface{}) Notification {
+	return Notification{JSONRPC: Version, Method: method, Params: params}
+}
+
+// LooksLikeRequest reports whether a raw WebSocket frame looks like a
+// JSON-RPC 2.0 request rather than one of netmon's legacy plain-string
+// frames (e.g. "Start-CLI").
+func LooksLikeRequest(data []byte) bool {
+	var probe struct {
+		JSONRPC string `json:"jsonrpc"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return false
+	}
+	return probe.JSONRPC == Version
+}
+
+// MethodFunc is the signature netmon's RPC methods are implemented with.
+// A non-nil *Error is reported to the caller as the response's error
+// object; otherwise result is marshalled as the response's result.
+type MethodFunc func(params json.RawMessage) (interface{}, *Error)
+
+// Mux maps method names to their implementations and dispatches incoming
+// requests to them.
+type Mux struct {
+	methods map[string]MethodFunc
+}
+
+// NewMux creates an empty Mux.
+func NewMux() *Mux {
+	return &Mux{methods: make(map[string]MethodFunc)}
+}
+
+// Handle registers fn as the implementation of method.
+func (m *Mux) Handle(method string, fn MethodFunc) {
+	m.methods[method] = fn
+}
+
+// Dispatch decodes data as a Request, invokes the registered method, and
+// returns the Response to send back. It returns nil for notifications
+// (requests with no id), since no reply is expected in that case.
+func (m *Mux) Dispatch(data []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &Response{JSONRPC: Version, Error: &Error{Code: CodeParseError, Message: "Parse error"}}
+	}
+	if req.JSONRPC != Version || req.Method == "" {
+		resp := &Response{JSONRPC: Version, Error: &Error{Code: CodeInvalidRequest, Message: "Invalid Request"}, ID: req.ID}
+		if req.IsNotification() {
+			return nil
+		}
+		return resp
+	}
+
+	fn, ok := m.methods[req.Method]
+	if !ok {
+		if req.IsNotification() {
+			return nil
+		}
+		return &Response{JSONRPC: Version, Error: &Error{Code: CodeMethodNotFound, Message: "Method not found"}, ID: req.ID}
+	}
+
+	result, rpcErr := fn(req.Params)
+	if req.IsNotification() {
+		return nil
+	}
+	if rpcErr != nil {
+		return &Response{JSONRPC: Version, Error: rpcErr, ID: req.ID}
+	}
+	return &Response{JSONRPC: Version, Result: result, ID: req.ID}
+}
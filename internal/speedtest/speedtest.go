@@ -0,0 +1,205 @@
+// Package speedtest implements a minimal native TCP throughput probe, modeled
+// on Tailscale's net/speedtest client/server pattern. It lets two netmon
+// instances measure LAN throughput between each other without depending on
+// Ookla's speedtest-cli infrastructure.
+//
+// The protocol is deliberately simple: the client dials the server over TCP,
+// writes a small JSON header describing the kind of probe (upload or
+// download) and how long it should run, and then one side streams a fixed
+// size buffer to the other until the duration elapses.
+package speedtest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"time"
+)
+
+// bufSize is the size of the buffer written/read during upload and download
+// probes.
+const bufSize = 64 * 1024
+
+// sampleInterval is how often throughput samples are recorded during a run.
+const sampleInterval = 100 * time.Millisecond
+
+// headerReadTimeout bounds how long serveConn waits for a client to send its
+// header, independent of the probe's own duration (which isn't known until
+// the header is parsed). Without it, a client that connects and never
+// writes pins a goroutine and fd open indefinitely.
+const headerReadTimeout = 10 * time.Second
+
+// Probe type strings used in the header exchanged between client and server.
+const (
+	typeDownload = "download"
+	typeUpload   = "upload"
+)
+
+// header is the small JSON handshake the client sends before a probe begins.
+type header struct {
+	Type       string `json:"type"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Sample is the throughput measured over a single sampleInterval window.
+type Sample struct {
+	ElapsedMs int64   `json:"elapsed_ms"`
+	Bytes     int64   `json:"bytes"`
+	Mbps      float64 `json:"mbps"`
+}
+
+// Result is the aggregate outcome of a single upload or download run.
+type Result struct {
+	Samples []Sample `json:"samples"`
+	Bytes   int64    `json:"bytes"`
+	Mbps    float64  `json:"mbps"`
+}
+
+// RunDownload dials host and measures the throughput of a stream of bytes
+// sent from host to us over dur.
+func RunDownload(ctx context.Context, host string, dur time.Duration) (Result, error) {
+	return run(ctx, host, typeDownload, dur)
+}
+
+// RunUpload dials host and measures the throughput of a stream of bytes we
+// send to host over dur.
+func RunUpload(ctx context.Context, host string, dur time.Duration) (Result, error) {
+	return run(ctx, host, typeUpload, dur)
+}
+
+// run performs the client side of the probe described by kind against host.
+func run(ctx context.Context, host string, kind string, dur time.Duration) (Result, error) {
+	var res Result
+
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return res, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	deadline := start.Add(dur)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return res, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(header{Type: kind, DurationMs: dur.Milliseconds()}); err != nil {
+		return res, err
+	}
+
+	buf := make([]byte, bufSize)
+	var total, windowBytes int64
+	windowStart := start
+
+	for time.Now().Before(deadline) {
+		var n int
+		if kind == typeUpload {
+			n, err = conn.Write(buf)
+		} else {
+			n, err = conn.Read(buf)
+		}
+		total += int64(n)
+		windowBytes += int64(n)
+
+		if now := time.Now(); now.Sub(windowStart) >= sampleInterval {
+			res.Samples = append(res.Samples, newSample(now.Sub(start), now.Sub(windowStart), windowBytes))
+			windowBytes = 0
+			windowStart = now
+		}
+
+		if err != nil {
+			if isTimeout(err) || err == io.EOF {
+				break
+			}
+			return res, err
+		}
+	}
+	if windowBytes > 0 {
+		now := time.Now()
+		res.Samples = append(res.Samples, newSample(now.Sub(start), now.Sub(windowStart), windowBytes))
+	}
+
+	res.Bytes = total
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		res.Mbps = float64(total) * 8 / elapsed / 1e6
+	}
+	return res, nil
+}
+
+// newSample builds a Sample for a window of length window that ended elapsed
+// after the start of the run and moved bytes bytes.
+func newSample(elapsed, window time.Duration, bytes int64) Sample {
+	mbps := 0.0
+	if window > 0 {
+		mbps = float64(bytes) * 8 / window.Seconds() / 1e6
+	}
+	return Sample{ElapsedMs: elapsed.Milliseconds(), Bytes: bytes, Mbps: mbps}
+}
+
+// isTimeout reports whether err is a net.Error that timed out, which is how
+// a probe's deadline expiring surfaces from Read/Write.
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
+
+// Serve accepts connections on ln and serves each as a speedtest peer,
+// responding to whichever probe kind the client requests, until ln is
+// closed or ctx is cancelled.
+func Serve(ctx context.Context, ln net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+				return err
+			}
+		}
+		go serveConn(conn)
+	}
+}
+
+// serveConn handles a single incoming probe connection: it reads the header
+// and then streams (or drains) bufSize buffers until the requested duration
+// elapses.
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(headerReadTimeout)); err != nil {
+		return
+	}
+
+	var h header
+	if err := json.NewDecoder(conn).Decode(&h); err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(time.Duration(h.DurationMs) * time.Millisecond)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return
+	}
+
+	buf := make([]byte, bufSize)
+	for time.Now().Before(deadline) {
+		var err error
+		switch h.Type {
+		case typeDownload:
+			_, err = conn.Write(buf)
+		case typeUpload:
+			_, err = conn.Read(buf)
+		default:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// MemoryStore is a non-durable Store implementation used for tests and for
+// running netmon without a -db path configured. It never downsamples, so
+// Query treats Hourly and Daily the same as Raw. Like SQLiteStore, it honors
+// retainRaw: samples older than retainRaw are dropped on Append, so -db ""
+// doesn't grow without bound.
+type MemoryStore struct {
+	mtx       sync.Mutex
+	perfs     []messages.PerfJSON
+	retainRaw time.Duration
+}
+
+// NewMemoryStore creates an empty MemoryStore. retainRaw bounds how long
+// samples are kept around; 0 disables pruning and keeps every sample, same
+// as SQLiteStore.
+func NewMemoryStore(retainRaw time.Duration) *MemoryStore {
+	return &MemoryStore{retainRaw: retainRaw}
+}
+
+// Append records perf in memory and prunes anything now older than
+// retainRaw.
+func (m *MemoryStore) Append(perf messages.PerfJSON) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.perfs = append(m.perfs, perf)
+	m.prune()
+	return nil
+}
+
+// prune drops samples older than retainRaw. m.mtx must be held. Samples are
+// appended in arrival order, so the first one still within retention also
+// bounds every sample after it.
+func (m *MemoryStore) prune() {
+	if m.retainRaw <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-m.retainRaw)
+	for i, p := range m.perfs {
+		ts, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil || !ts.Before(cutoff) {
+			m.perfs = m.perfs[i:]
+			return
+		}
+	}
+	m.perfs = nil
+}
+
+// Query returns every stored result whose Timestamp falls within
+// [from, to]. agg is ignored, since MemoryStore keeps only raw samples.
+func (m *MemoryStore) Query(from, to time.Time, agg Aggregation) ([]messages.PerfJSON, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var out []messages.PerfJSON
+	for _, p := range m.perfs {
+		ts, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil || ts.Before(from) || ts.After(to) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Latest returns the most recent n results, oldest first.
+func (m *MemoryStore) Latest(n int) ([]messages.PerfJSON, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if n <= 0 || n >= len(m.perfs) {
+		return append([]messages.PerfJSON(nil), m.perfs...), nil
+	}
+	return append([]messages.PerfJSON(nil), m.perfs[len(m.perfs)-n:]...), nil
+}
+
+// Close is a no-op for MemoryStore.
+func (m *MemoryStore) Close() error {
+	return nil
+}
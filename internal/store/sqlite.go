@@ -0,0 +1,334 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// SQLiteStore is the default, durable Store implementation. It keeps every
+// raw sample plus pre-aggregated hourly and daily rollups (computed on
+// write) so that querying a long history stays cheap. It uses
+// modernc.org/sqlite, which needs no cgo.
+type SQLiteStore struct {
+	db           *sql.DB
+	retainRaw    time.Duration
+	retainHourly time.Duration
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS raw (
+	ts    TEXT PRIMARY KEY,
+	ts_ns INTEGER,
+	ping  REAL,
+	down  REAL,
+	up    REAL,
+	data  TEXT
+);
+CREATE TABLE IF NOT EXISTS hourly (
+	bucket    TEXT PRIMARY KEY,
+	ping_med  REAL,
+	down_med  REAL,
+	up_med    REAL,
+	ping_min  REAL,
+	down_min  REAL,
+	up_min    REAL,
+	ping_max  REAL,
+	down_max  REAL,
+	up_max    REAL
+);
+CREATE TABLE IF NOT EXISTS daily (
+	bucket    TEXT PRIMARY KEY,
+	ping_med  REAL,
+	down_med  REAL,
+	up_med    REAL,
+	ping_min  REAL,
+	down_min  REAL,
+	up_min    REAL,
+	ping_max  REAL,
+	down_max  REAL,
+	up_max    REAL
+);
+`
+
+// NewSQLiteStore opens (creating if necessary) a SQLite database at path.
+func NewSQLiteStore(path string, retainRaw, retainHourly time.Duration) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("store: open %s: %w", path, err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("store: create schema: %w", err)
+	}
+	if err := migrateRawTsNs(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db, retainRaw: retainRaw, retainHourly: retainHourly}, nil
+}
+
+// migrateRawTsNs adds raw.ts_ns to databases created before this column
+// existed, and backfills it by parsing each existing row's ts. Every range
+// query now compares against ts_ns rather than ts: ts keeps perf.Timestamp
+// verbatim, which for the CLI engine includes speedtest-cli's
+// fractional-second suffix (e.g. "...13:00:00.5Z"), and lexicographically
+// comparing that as TEXT against the whole-second RFC3339 bucket/range
+// boundaries used elsewhere sorts it into the wrong bucket.
+func migrateRawTsNs(db *sql.DB) error {
+	if _, err := db.Exec(`ALTER TABLE raw ADD COLUMN ts_ns INTEGER`); err != nil {
+		if !strings.Contains(err.Error(), "duplicate column") {
+			return fmt.Errorf("store: add ts_ns column: %w", err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT ts FROM raw WHERE ts_ns IS NULL`)
+	if err != nil {
+		return fmt.Errorf("store: query rows to backfill ts_ns: %w", err)
+	}
+	var stamps []string
+	for rows.Next() {
+		var ts string
+		if err := rows.Scan(&ts); err != nil {
+			rows.Close()
+			return fmt.Errorf("store: scan row to backfill ts_ns: %w", err)
+		}
+		stamps = append(stamps, ts)
+	}
+	rows.Close()
+
+	for _, ts := range stamps {
+		parsed, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			continue
+		}
+		if _, err := db.Exec(`UPDATE raw SET ts_ns = ? WHERE ts = ?`, parsed.UnixNano(), ts); err != nil {
+			return fmt.Errorf("store: backfill ts_ns: %w", err)
+		}
+	}
+	return nil
+}
+
+// Append inserts perf as a raw sample, recomputes the hourly and daily
+// rollups covering its timestamp, and prunes anything now older than the
+// configured retention.
+func (s *SQLiteStore) Append(perf messages.PerfJSON) error {
+	ts, err := time.Parse(time.RFC3339, perf.Timestamp)
+	if err != nil {
+		ts = time.Now().UTC()
+		perf.Timestamp = ts.Format(time.RFC3339)
+	}
+
+	data, err := json.Marshal(perf)
+	if err != nil {
+		return fmt.Errorf("store: marshal result: %w", err)
+	}
+
+	if _, err := s.db.Exec(
+		`INSERT OR REPLACE INTO raw (ts, ts_ns, ping, down, up, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		perf.Timestamp, ts.UnixNano(), perf.Ping, perf.Download, perf.Upload, string(data),
+	); err != nil {
+		return fmt.Errorf("store: insert raw: %w", err)
+	}
+
+	if err := s.rollup("hourly", ts.Truncate(time.Hour)); err != nil {
+		return err
+	}
+	if err := s.rollup("daily", ts.Truncate(24*time.Hour)); err != nil {
+		return err
+	}
+
+	s.prune()
+	return nil
+}
+
+// rollup recomputes the min/median/max of every raw sample falling in the
+// bucket starting at bucketStart (one hour or one day wide, depending on
+// table) and upserts it into table.
+func (s *SQLiteStore) rollup(table string, bucketStart time.Time) error {
+	var width time.Duration
+	if table == "hourly" {
+		width = time.Hour
+	} else {
+		width = 24 * time.Hour
+	}
+	bucketEnd := bucketStart.Add(width)
+
+	rows, err := s.db.Query(
+		`SELECT ping, down, up FROM raw WHERE ts_ns >= ? AND ts_ns < ?`,
+		bucketStart.UnixNano(), bucketEnd.UnixNano(),
+	)
+	if err != nil {
+		return fmt.Errorf("store: query raw for rollup: %w", err)
+	}
+	defer rows.Close()
+
+	var pings, downs, ups []float64
+	for rows.Next() {
+		var ping, down, up float64
+		if err := rows.Scan(&ping, &down, &up); err != nil {
+			return fmt.Errorf("store: scan raw for rollup: %w", err)
+		}
+		pings = append(pings, ping)
+		downs = append(downs, down)
+		ups = append(ups, up)
+	}
+	if len(pings) == 0 {
+		return nil
+	}
+
+	pingMin, pingMed, pingMax := minMedianMax(pings)
+	downMin, downMed, downMax := minMedianMax(downs)
+	upMin, upMed, upMax := minMedianMax(ups)
+
+	_, err = s.db.Exec(
+		fmt.Sprintf(`INSERT OR REPLACE INTO %s (
+			bucket, ping_med, down_med, up_med, ping_min, down_min, up_min, ping_max, down_max, up_max
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, table),
+		bucketStart.Format(time.RFC3339),
+		pingMed, downMed, upMed,
+		pingMin, downMin, upMin,
+		pingMax, downMax, upMax,
+	)
+	if err != nil {
+		return fmt.Errorf("store: upsert %s rollup: %w", table, err)
+	}
+	return nil
+}
+
+// minMedianMax returns the minimum, median, and maximum of vals. vals must
+// be non-empty.
+func minMedianMax(vals []float64) (min, median, max float64) {
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+
+	min, max = sorted[0], sorted[len(sorted)-1]
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		median = (sorted[mid-1] + sorted[mid]) / 2
+	} else {
+		median = sorted[mid]
+	}
+	return min, median, max
+}
+
+// Query returns results between from and to at the requested aggregation.
+// Raw returns the full stored PerfJSON for each sample; Hourly and Daily
+// return one PerfJSON per bucket, with Ping/Download/Upload set to that
+// bucket's median and Timestamp set to the bucket's start.
+func (s *SQLiteStore) Query(from, to time.Time, agg Aggregation) ([]messages.PerfJSON, error) {
+	switch agg {
+	case Hourly:
+		return s.queryRollup("hourly", from, to)
+	case Daily:
+		return s.queryRollup("daily", from, to)
+	default:
+		return s.queryRaw(from, to)
+	}
+}
+
+func (s *SQLiteStore) queryRaw(from, to time.Time) ([]messages.PerfJSON, error) {
+	rows, err := s.db.Query(
+		`SELECT data FROM raw WHERE ts_ns >= ? AND ts_ns <= ? ORDER BY ts_ns ASC`,
+		from.UnixNano(), to.UnixNano(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("store: query raw: %w", err)
+	}
+	defer rows.Close()
+
+	var out []messages.PerfJSON
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("store: scan raw: %w", err)
+		}
+		var perf messages.PerfJSON
+		if err := json.Unmarshal([]byte(data), &perf); err != nil {
+			return nil, fmt.Errorf("store: unmarshal raw: %w", err)
+		}
+		out = append(out, perf)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) queryRollup(table string, from, to time.Time) ([]messages.PerfJSON, error) {
+	rows, err := s.db.Query(
+		fmt.Sprintf(`SELECT bucket, ping_med, down_med, up_med FROM %s WHERE bucket >= ? AND bucket <= ? ORDER BY bucket ASC`, table),
+		from.Format(time.RFC3339), to.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("store: query %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var out []messages.PerfJSON
+	for rows.Next() {
+		var bucket string
+		var perf messages.PerfJSON
+		if err := rows.Scan(&bucket, &perf.Ping, &perf.Download, &perf.Upload); err != nil {
+			return nil, fmt.Errorf("store: scan %s: %w", table, err)
+		}
+		perf.Timestamp = bucket
+		out = append(out, perf)
+	}
+	return out, nil
+}
+
+// Latest returns the most recent n raw results, oldest first.
+func (s *SQLiteStore) Latest(n int) ([]messages.PerfJSON, error) {
+	query := `SELECT data FROM raw ORDER BY ts_ns DESC`
+	if n > 0 {
+		query += fmt.Sprintf(" LIMIT %d", n)
+	}
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("store: query latest: %w", err)
+	}
+	defer rows.Close()
+
+	var out []messages.PerfJSON
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("store: scan latest: %w", err)
+		}
+		var perf messages.PerfJSON
+		if err := json.Unmarshal([]byte(data), &perf); err != nil {
+			return nil, fmt.Errorf("store: unmarshal latest: %w", err)
+		}
+		out = append(out, perf)
+	}
+
+	// Reverse, since we queried newest-first but Latest promises oldest-first.
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+// prune deletes raw samples older than retainRaw and hourly rollups older
+// than retainHourly. Daily rollups are kept indefinitely.
+func (s *SQLiteStore) prune() {
+	if s.retainRaw > 0 {
+		cutoff := time.Now().Add(-s.retainRaw).UnixNano()
+		s.db.Exec(`DELETE FROM raw WHERE ts_ns < ?`, cutoff)
+	}
+	if s.retainHourly > 0 {
+		cutoff := time.Now().Add(-s.retainHourly).Format(time.RFC3339)
+		s.db.Exec(`DELETE FROM hourly WHERE bucket < ?`, cutoff)
+	}
+}
+
+// Close closes the underlying database handle.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
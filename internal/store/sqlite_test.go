@@ -0,0 +1,80 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+func TestMinMedianMax(t *testing.T) {
+	cases := []struct {
+		name             string
+		vals             []float64
+		min, median, max float64
+	}{
+		{"single", []float64{5}, 5, 5, 5},
+		{"odd", []float64{3, 1, 2}, 1, 2, 3},
+		{"even", []float64{1, 2, 3, 4}, 1, 2.5, 4},
+		{"unsorted even", []float64{40, 10, 30, 20}, 10, 25, 40},
+		{"duplicates", []float64{2, 2, 2}, 2, 2, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// minMedianMax must not mutate its input.
+			orig := append([]float64(nil), c.vals...)
+
+			min, median, max := minMedianMax(c.vals)
+			if min != c.min || median != c.median || max != c.max {
+				t.Errorf("minMedianMax(%v) = (%v, %v, %v), want (%v, %v, %v)",
+					orig, min, median, max, c.min, c.median, c.max)
+			}
+			for i, v := range c.vals {
+				if v != orig[i] {
+					t.Errorf("minMedianMax(%v) mutated input to %v", orig, c.vals)
+					break
+				}
+			}
+		})
+	}
+}
+
+// TestSQLiteStoreFractionalTimestamps confirms that a sample whose
+// perf.Timestamp carries a fractional-second suffix (as speedtest-cli's do)
+// still lands in the correct hourly bucket and range query, rather than
+// sorting into the previous bucket because "." sorts before "Z" in a raw
+// TEXT comparison against the whole-second bucket boundary.
+func TestSQLiteStoreFractionalTimestamps(t *testing.T) {
+	st, err := NewSQLiteStore(filepath.Join(t.TempDir(), "netmon.db"), 0, 0)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer st.Close()
+
+	bucketStart := time.Date(2026, 1, 1, 13, 0, 0, 0, time.UTC)
+	perf := messages.PerfJSON{
+		Timestamp: bucketStart.Add(500 * time.Millisecond).Format(time.RFC3339Nano),
+		Download:  100e6,
+	}
+	if err := st.Append(perf); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	hourly, err := st.Query(bucketStart, bucketStart.Add(time.Hour), Hourly)
+	if err != nil {
+		t.Fatalf("Query(Hourly): %v", err)
+	}
+	if len(hourly) != 1 {
+		t.Fatalf("got %d hourly buckets covering the sample's hour, want 1 (sample sorted into the wrong bucket)", len(hourly))
+	}
+
+	raw, err := st.Query(bucketStart, bucketStart.Add(time.Hour), Raw)
+	if err != nil {
+		t.Fatalf("Query(Raw): %v", err)
+	}
+	if len(raw) != 1 {
+		t.Fatalf("got %d raw results in [bucketStart, bucketStart+1h], want 1", len(raw))
+	}
+}
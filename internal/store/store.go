@@ -0,0 +1,52 @@
+// Package store persists speed test results so history survives restarts,
+// with retention and coarse downsampling for older data. Two
+// implementations are provided: a default SQLite-backed Store and a
+// MemoryStore used for tests or when no database path is configured.
+package store
+
+import (
+	"time"
+
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// Aggregation selects the granularity Query returns results at.
+type Aggregation string
+
+// The aggregations a Store must support. Hourly and Daily are
+// pre-computed on write, so querying them is cheap even over a long
+// history.
+const (
+	Raw    Aggregation = "raw"
+	Hourly Aggregation = "hour"
+	Daily  Aggregation = "day"
+)
+
+// Store persists PerfJSON results and makes them queryable by time range
+// and aggregation.
+type Store interface {
+	// Append durably records a newly completed test result.
+	Append(perf messages.PerfJSON) error
+	// Query returns results recorded between from and to (inclusive), at
+	// the requested aggregation. For Hourly and Daily, the returned
+	// PerfJSON's Ping/Download/Upload are the median of the samples in
+	// that bucket, and Timestamp is the bucket's start.
+	Query(from, to time.Time, agg Aggregation) ([]messages.PerfJSON, error)
+	// Latest returns the most recent n raw results, oldest first. n <= 0
+	// means "all of them".
+	Latest(n int) ([]messages.PerfJSON, error)
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// Open returns a SQLite-backed Store rooted at path, or a MemoryStore if
+// path is empty. retainRaw and retainHourly bound how long raw samples and
+// hourly rollups are kept around, respectively; daily rollups are kept
+// indefinitely. MemoryStore has no hourly rollups, so retainHourly is
+// ignored when path is empty.
+func Open(path string, retainRaw, retainHourly time.Duration) (Store, error) {
+	if path == "" {
+		return NewMemoryStore(retainRaw), nil
+	}
+	return NewSQLiteStore(path, retainRaw, retainHourly)
+}
@@ -1,8 +1,10 @@
 package messages
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 )
 
 // Indicies used for interpretting the output of speedtest-cli when using the
@@ -120,6 +122,10 @@ const ResultType = "result"
 // initType is the string encoding for the type used to initialize a client
 const InitType = "init"
 
+// NetEventType is the string encoding for the type used for interface and
+// address change notifications pushed from internal/netwatch.
+const NetEventType = "netevent"
+
 // Result is a structure that wraps a type with the the data to be sent to the
 // client. The Type can be a status message, a test results, or an
 // initialization message
@@ -127,3 +133,76 @@ type Result struct {
 	Type string `json:"type"`
 	Data string `json:"data"`
 }
+
+// NetEvent describes a single interface or address change detected by
+// internal/netwatch. It is JSON-encoded into a Result's Data field and sent
+// to clients as a Result of type NetEventType.
+type NetEvent struct {
+	Iface     string    `json:"iface"`
+	Kind      string    `json:"kind"`
+	Addr      string    `json:"addr,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AlertType is the string encoding for the type used for SLA alert
+// notifications pushed from internal/alert.
+const AlertType = "alert"
+
+// Alert describes a single SLA rule breach detected by internal/alert. It
+// is JSON-encoded into a Result's Data field and sent to clients as a
+// Result of type AlertType.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Message   string    `json:"message"`
+	Result    PerfJSON  `json:"result"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// RPCResponse mirrors the wire format of internal/rpc.Response: the JSON-RPC
+// 2.0 response netmon sends back over /ws or /rpc for a netmon.* method
+// call, for both successful results and errors. It's defined here rather
+// than only in internal/rpc so that a client outside this module -- which
+// can't import an internal package -- has something to decode control API
+// responses into.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// RPCError mirrors the wire format of internal/rpc.Error, and also
+// implements Go's error interface so it can be returned from
+// RPCResponse.Into directly.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Error implements the error interface for RPCError.
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// ParseRPCResponse decodes data, a single JSON-RPC 2.0 response as received
+// from netmon's /ws or /rpc endpoints, into an RPCResponse.
+func ParseRPCResponse(data []byte) (*RPCResponse, error) {
+	var resp RPCResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("messages: parse RPC response: %w", err)
+	}
+	return &resp, nil
+}
+
+// Into reports r.Error, if any, or otherwise unmarshals r.Result into v, the
+// result type expected for whichever netmon.* method was called.
+func (r *RPCResponse) Into(v interface{}) error {
+	if r.Error != nil {
+		return r.Error
+	}
+	if len(r.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(r.Result, v)
+}
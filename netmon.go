@@ -1,20 +1,35 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os/exec"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/pgrahamdev/netmon/internal/alert"
+	"github.com/pgrahamdev/netmon/internal/metrics"
+	"github.com/pgrahamdev/netmon/internal/netwatch"
+	"github.com/pgrahamdev/netmon/internal/rpc"
+	"github.com/pgrahamdev/netmon/internal/speedtest"
+	"github.com/pgrahamdev/netmon/internal/store"
+	"github.com/pgrahamdev/netmon/messages"
 )
 
+// initHistoryLimit is how many of the most recent results are sent to a
+// WebSocket client when it first connects.
+const initHistoryLimit = 50
+
 var upgrader = websocket.Upgrader{} // use default options
 
 const swVersion = 2
@@ -112,19 +127,6 @@ type PerfJSON struct {
 	Ping          float64 `json:"ping"`
 }
 
-// A simple print method for the PerfJSON type
-func (pr PerfJSON) print() {
-	fmt.Println("---")
-	fmt.Println("ServerID:", pr.Server.ID)
-	fmt.Println("ServerName:", pr.Server.Sponsor)
-	fmt.Println("Location:", pr.Server.Location)
-	fmt.Println("Date:", pr.Timestamp)
-	fmt.Printf("Distance: %.2f km\n", pr.Server.Distance)
-	fmt.Printf("PingLatency: %.2f ms\n", pr.Ping)
-	fmt.Printf("DownloadRate: %.2f Mb/s\n", pr.Download/1e6)
-	fmt.Printf("UploadRate: %.2f Mb/s\n", pr.Upload/1e6)
-}
-
 // statusType is the string encoding for the type used for status messages
 const statusType = "status"
 
@@ -152,14 +154,49 @@ func (gse GetSpeedError) Error() string {
 	return gse.ErrorString
 }
 
-// getSpeedTestInfo executes speedtest-cli.  If the value of server is > -1,
+// ErrSpeedtestMissing is returned by getSpeedTestInfoCLI when the
+// speedtest-cli binary isn't found on PATH, so callers (netmon.runTest, via
+// testOutcome.err) can tell this apart from a speedtest-cli invocation that
+// ran but failed, and report rpc.CodeSpeedtestMissing instead of a generic
+// failure.
+var ErrSpeedtestMissing = errors.New("speedtest-cli binary not found")
+
+// engineCLI and engineNative are the supported values for the -engine flag.
+// engineCLI shells out to speedtest-cli, as netmon has always done.
+// engineNative drives the internal/speedtest package against a peer netmon
+// instance instead.
+const (
+	engineCLI    = "cli"
+	engineNative = "native"
+)
+
+// nativeProbeDuration is how long each of the native download and upload
+// probes runs for.
+const nativeProbeDuration = 10 * time.Second
+
+// getSpeedTestInfo runs a speed test using the requested engine. If the
+// value of server is > -1, then the value is used to query a specific
+// server by server ID (meaningful only for engineCLI). For engineNative,
+// peer is the address of the netmon instance to measure against. testID
+// identifies this test run in netmon's structured logs.
+//
+// The return value is a PerfJSON structure populated with the results of the
+// test and an error.
+func getSpeedTestInfo(testID int64, server int, engine string, peer string) (PerfJSON, error) {
+	if engine == engineNative {
+		return getSpeedTestInfoNative(testID, peer)
+	}
+	return getSpeedTestInfoCLI(testID, server)
+}
+
+// getSpeedTestInfoCLI executes speedtest-cli.  If the value of server is > -1,
 // then the value is used to query a specific server by server ID.  Otherwise,
 // speedtest-cli is run without specifying the server, allowing speedtest-cli to
 // determine which remote server to use for the test.
 //
 // The return value is a PerfJSON structure used to parse the JSON results of
 // speedtest-cli and an error.
-func getSpeedTestInfo(server int) (PerfJSON, error) {
+func getSpeedTestInfoCLI(testID int64, server int) (PerfJSON, error) {
 	var serverID string
 	if server > -1 {
 		serverID = strconv.Itoa(server)
@@ -180,6 +217,9 @@ func getSpeedTestInfo(server int) (PerfJSON, error) {
 	}
 	dec := json.NewDecoder(stdout)
 	if err = cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return perf, ErrSpeedtestMissing
+		}
 		return perf, err
 	}
 	if err = dec.Decode(&perf); err == io.EOF {
@@ -190,24 +230,177 @@ func getSpeedTestInfo(server int) (PerfJSON, error) {
 	if err = cmd.Wait(); err != nil {
 		return perf, err
 	}
-	perf.print()
+	logger.Info("Speed test completed", "test_id", testID, "engine", engineCLI,
+		"server_id", perf.Server.ID, "sponsor", perf.Server.Sponsor,
+		"download_mbps", perf.Download/1e6, "upload_mbps", perf.Upload/1e6, "ping_ms", perf.Ping)
 	return perf, err
 }
 
+// getSpeedTestInfoNative measures throughput against peer using the native
+// internal/speedtest protocol and populates a PerfJSON equivalent to what
+// getSpeedTestInfoCLI would produce, so downstream consumers (the WebSocket
+// protocol and browser client) don't need to care which engine was used.
+func getSpeedTestInfoNative(testID int64, peer string) (PerfJSON, error) {
+	var perf PerfJSON
+	if peer == "" {
+		return perf, GetSpeedError{ErrorString: "No peer address provided for native speed test."}
+	}
+
+	ctx := context.Background()
+
+	pingStart := time.Now()
+	conn, err := net.Dial("tcp", peer)
+	if err != nil {
+		return perf, err
+	}
+	latency := time.Since(pingStart)
+	conn.Close()
+
+	down, err := speedtest.RunDownload(ctx, peer, nativeProbeDuration)
+	if err != nil {
+		return perf, err
+	}
+	up, err := speedtest.RunUpload(ctx, peer, nativeProbeDuration)
+	if err != nil {
+		return perf, err
+	}
+
+	perf.Server.ID = peer
+	perf.Server.Sponsor = "netmon native peer"
+	perf.Server.Host = peer
+	perf.Ping = float64(latency.Microseconds()) / 1000
+	perf.Download = down.Mbps * 1e6
+	perf.Upload = up.Mbps * 1e6
+	perf.BytesReceived = float64(down.Bytes)
+	perf.BytesSent = float64(up.Bytes)
+	perf.Timestamp = time.Now().UTC().Format(time.RFC3339)
+
+	logger.Info("Speed test completed", "test_id", testID, "engine", engineNative,
+		"peer", peer, "download_mbps", perf.Download/1e6, "upload_mbps", perf.Upload/1e6, "ping_ms", perf.Ping)
+	return perf, nil
+}
+
+// testRequest is sent on HandlerContext.reqChan to trigger a speed test.
+// server overrides ctx.server for this one run if non-nil (used by
+// netmon.runTest's serverId parameter); done, if non-nil, receives the
+// test's outcome so the caller can wait for completion without polling
+// shared state.
+type testRequest struct {
+	server *int
+	done   chan<- testOutcome
+}
+
+// testOutcome is sent back on a testRequest's done channel once the test
+// it triggered has finished.
+type testOutcome struct {
+	perf PerfJSON
+	err  error
+}
+
 // HandlerContext provides a context for the WebSockets.  The state for
-// WebSocket handling and the slice of test results are stored here.  These
-// could have been global variables for the program, but they are all stored in
-// a single structure for this implementation.
+// WebSocket handling is stored here.  These could have been global
+// variables for the program, but they are all stored in a single structure
+// for this implementation. mtx guards the fields that are read and written
+// from more than one goroutine: wsMap, subs, running, nextRun, and period.
 type HandlerContext struct {
-	mtx     sync.Mutex
-	perfs   []PerfJSON
-	reqChan chan bool
-	wsMap   map[*websocket.Conn]bool
+	mtx        sync.Mutex
+	reqChan    chan testRequest
+	periodChan chan int
+	wsMap      map[*websocket.Conn]bool
+	subs       map[*websocket.Conn]map[string]bool
+	running    bool
+	period     int
+	nextRun    time.Time
+	server     int
+	engine     string
+	peer       string
+	mux        *rpc.Mux
+	store      store.Store
+	alerts     *alert.Engine
+	metrics    *metrics.Metrics
+	testSeq    int64
 }
 
 // NewHandlerContext creates a new HandlerContext struct
-func NewHandlerContext() *HandlerContext {
-	return &HandlerContext{reqChan: make(chan bool), wsMap: make(map[*websocket.Conn]bool)}
+func NewHandlerContext(server int, engine string, peer string, period int, st store.Store, alerts *alert.Engine, met *metrics.Metrics) *HandlerContext {
+	ctx := &HandlerContext{
+		reqChan:    make(chan testRequest),
+		periodChan: make(chan int),
+		wsMap:      make(map[*websocket.Conn]bool),
+		subs:       make(map[*websocket.Conn]map[string]bool),
+		server:     server,
+		engine:     engine,
+		peer:       peer,
+		period:     period,
+		store:      st,
+		alerts:     alerts,
+		metrics:    met,
+	}
+	ctx.mux = ctx.buildRPCMux()
+	return ctx
+}
+
+// nextTestID returns a new, monotonically increasing identifier for a
+// speed test run, used to correlate its structured log lines.
+func (ctx *HandlerContext) nextTestID() int64 {
+	return atomic.AddInt64(&ctx.testSeq, 1)
+}
+
+// setRunning updates ctx.running under ctx.mtx, since it's written by
+// speedtestHandler and read by the netmon.runTest and netmon.getStatus RPC
+// methods from other goroutines.
+func (ctx *HandlerContext) setRunning(running bool) {
+	ctx.mtx.Lock()
+	ctx.running = running
+	ctx.mtx.Unlock()
+}
+
+// tryBeginTest atomically checks whether a test is already running and, if
+// not, reserves ctx.running for the caller's own test before returning true.
+// This is what makes netmon.runTest's already-running check race-free
+// among netmon.runTest callers: a separate read of ctx.running followed by a
+// send on ctx.reqChan leaves a window where two callers can both observe
+// "not running" and both send, and since reqChan is unbuffered, the loser
+// blocks on that send until speedtestHandler finishes the winner's test.
+// Reserving ctx.running here means at most one caller ever wins. Requests
+// sent by speedtestTimer, legacy WebSocket frames, and watchNetwork don't go
+// through this reservation, so the winner's send can still wait behind one
+// of those tests, and runTestTimeout only starts counting once that send
+// returns.
+func (ctx *HandlerContext) tryBeginTest() bool {
+	ctx.mtx.Lock()
+	defer ctx.mtx.Unlock()
+	if ctx.running {
+		return false
+	}
+	ctx.running = true
+	return true
+}
+
+// setNextRun updates ctx.nextRun under ctx.mtx, since it's written by
+// speedtestTimer and read by the netmon.getStatus RPC method from another
+// goroutine.
+func (ctx *HandlerContext) setNextRun(t time.Time) {
+	ctx.mtx.Lock()
+	ctx.nextRun = t
+	ctx.mtx.Unlock()
+}
+
+// setPeriod updates ctx.period under ctx.mtx, since it's written by
+// speedtestTimer and read by the netmon.getStatus RPC method from another
+// goroutine.
+func (ctx *HandlerContext) setPeriod(period int) {
+	ctx.mtx.Lock()
+	ctx.period = period
+	ctx.mtx.Unlock()
+}
+
+// status returns a consistent snapshot of ctx.running, ctx.nextRun, and
+// ctx.period for the netmon.getStatus and netmon.setPeriod RPC methods.
+func (ctx *HandlerContext) status() statusResult {
+	ctx.mtx.Lock()
+	defer ctx.mtx.Unlock()
+	return statusResult{Running: ctx.running, NextRun: ctx.nextRun, Period: ctx.period}
 }
 
 // WsHandler uses the context information to handle WebSocket requests
@@ -220,24 +413,41 @@ func (ctx *HandlerContext) WsHandler(w http.ResponseWriter, r *http.Request) {
 	// possible.
 	c, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Print("upgrade:", err)
+		logger.Error("WebSocket upgrade failed", "error", err, "client_addr", r.RemoteAddr)
 		return
 	}
-	fmt.Println("New web socket connection.")
+	logger.Info("WebSocket client connected", "client_addr", r.RemoteAddr)
 	// Add the connection as active to the WebSocket map
+	ctx.mtx.Lock()
 	ctx.wsMap[c] = true
-	// Make sure we close the connection when we exit the function
+	ctx.mtx.Unlock()
+	ctx.metrics.IncWSClients()
+	// Make sure we close the connection, and any RPC subscriptions it held,
+	// when we exit the function
 	defer c.Close()
-
-	// Used to hold the current list of performance test results
+	defer func() {
+		ctx.mtx.Lock()
+		delete(ctx.subs, c)
+		ctx.mtx.Unlock()
+	}()
+	defer ctx.metrics.DecWSClients()
+
+	// Used to hold the most recent performance test results, read from
+	// ctx.store so that, with a -db database configured, a freshly restarted
+	// netmon still has history to show.
 	var tmpData []byte
+	history, err := ctx.store.Latest(initHistoryLimit)
+	if err != nil {
+		logger.Error("Error reading history from store", "error", err, "client_addr", r.RemoteAddr)
+		history = nil
+	}
 	// Marshalling an empty slice returns "null",
 	// so check for the case and handle it
-	if len(ctx.perfs) > 0 {
+	if len(history) > 0 {
 		// Send the current data
-		tmpData, err = json.Marshal(ctx.perfs)
+		tmpData, err = json.Marshal(history)
 		if err != nil {
-			log.Println("Error encoding speedtest data.")
+			logger.Error("Error encoding speedtest data", "client_addr", r.RemoteAddr)
 			return
 		}
 	} else {
@@ -247,11 +457,13 @@ func (ctx *HandlerContext) WsHandler(w http.ResponseWriter, r *http.Request) {
 	// Wrap the initial state in a Result struct with type initType
 	err = c.WriteJSON(Result{Type: initType, Data: string(tmpData)})
 	if err != nil {
-		log.Println("write:", err)
+		logger.Error("WebSocket write failed", "error", err, "client_addr", r.RemoteAddr)
 		// If the connection has a problem, mark the WebSocket as inactive in
 		// the WebSocket map and return (we only want the sendWebSocketData
 		// function to clean up wsMap, otherwise craziness will ensue)
+		ctx.mtx.Lock()
 		ctx.wsMap[c] = false
+		ctx.mtx.Unlock()
 		return
 	}
 
@@ -259,81 +471,181 @@ func (ctx *HandlerContext) WsHandler(w http.ResponseWriter, r *http.Request) {
 	for {
 		_, message, err := c.ReadMessage()
 		if err != nil {
-			log.Println("read:", err)
+			logger.Error("WebSocket read failed", "error", err, "client_addr", r.RemoteAddr)
 			// Mark the WebSocket as inactive so it can be cleaned up by
 			// sendWebSocketData
+			ctx.mtx.Lock()
 			ctx.wsMap[c] = false
+			ctx.mtx.Unlock()
 			break
 		}
-		log.Printf("recv: %s", message)
+		logger.Debug("WebSocket frame received", "client_addr", r.RemoteAddr, "frame", string(message))
+		// A JSON-RPC 2.0 frame is routed through the rpc.Mux; anything else is
+		// treated as a legacy plain-string frame, which has only ever meant
+		// "start a test"
+		if rpc.LooksLikeRequest(message) {
+			if resp := ctx.dispatchWS(c, message); resp != nil {
+				if err := c.WriteJSON(resp); err != nil {
+					logger.Error("WebSocket write failed", "error", err, "client_addr", r.RemoteAddr)
+					ctx.mtx.Lock()
+					ctx.wsMap[c] = false
+					ctx.mtx.Unlock()
+					break
+				}
+			}
+			continue
+		}
 		// Send the reqChan a message to initiate a run of speedtest-cli
-		ctx.reqChan <- true
+		ctx.reqChan <- testRequest{}
 	}
 }
 
-// sendWebSocketData takes a map of WebSocket connection pointers and will send
-// a message to all active WebSockets.  If a WebSocket is inactive, it will
-// remove that WebSocket connection pointer from the map.  Only
+// sendWebSocketData sends a message to all of ctx's active WebSockets.  If a
+// WebSocket is inactive, it is removed from ctx.wsMap.  Only
 // sendWebSocketData can remove entries from the map for safety's sake.
-func sendWebSocketData(wsMap map[*websocket.Conn]bool, messageType string, data string) {
+// ctx.mtx is held for the duration, since ctx.wsMap is also read and written
+// from WsHandler's per-connection goroutines.
+func sendWebSocketData(ctx *HandlerContext, messageType string, data string) {
+	ctx.mtx.Lock()
+	defer ctx.mtx.Unlock()
 	// Send out a status message to all WebSockets
-	for conn, v := range wsMap {
+	for conn, v := range ctx.wsMap {
 		// We have a dead WebSocket.  Clean it up
 		if v == false {
 			conn.Close()
-			delete(wsMap, conn)
+			delete(ctx.wsMap, conn)
 			// Otherwise, let's try to use it
 		} else {
 			err := conn.WriteJSON(Result{Type: messageType, Data: data})
 			if err != nil {
 				log.Println("write:", err)
 				conn.Close()
-				delete(wsMap, conn)
+				delete(ctx.wsMap, conn)
 			}
 		}
 	}
 }
 
-// speedtestHandler waits for a request on the req channel, sends a status
-// message to the clients, runs speedtest-clie via getSpeedTestInfo, adds the
-// results to the results slice (perfs), and then sends the incremental result
-// to the clients.  We are passing perfs by reference so we can add to the slice.
-func speedtestHandler(server int, req chan bool, wsMap map[*websocket.Conn]bool, perfs *[]PerfJSON) {
+// speedtestHandler waits for a request on ctx.reqChan, sends a status
+// message to the clients, runs a speed test via getSpeedTestInfo using
+// ctx's configured engine (and peer, for the native engine), persists the
+// result to ctx.store, and then sends the incremental result to the
+// clients. If the request carries a done channel (as netmon.runTest's
+// does), the outcome is also sent there. ctx.running reflects whether a
+// test is currently in flight, which backs the netmon.getStatus RPC
+// method.
+func speedtestHandler(ctx *HandlerContext) {
 
 	var perf PerfJSON
 	var err error
 	for {
 		// Wait for a request
-		<-req
+		req := <-ctx.reqChan
+		server := ctx.server
+		if req.server != nil {
+			server = *req.server
+		}
+		ctx.setRunning(true)
+		testID := ctx.nextTestID()
 		// Send out a status message to all WebSockets
-		sendWebSocketData(wsMap, statusType, "Request made. Waiting for response.")
+		sendWebSocketData(ctx, statusType, "Request made. Waiting for response.")
+		notifySubscribers(ctx, topicStatus, "Request made. Waiting for response.")
 		// Request speedTest data
-		perf, err = getSpeedTestInfo(server)
+		start := time.Now()
+		perf, err = getSpeedTestInfo(testID, server, ctx.engine, ctx.peer)
+		duration := time.Since(start)
 		if err != nil {
-			log.Println("Error trying to get SpeedTest info.\n" + err.Error())
+			logger.Error("Speed test failed", "test_id", testID, "error", err)
 			// Send out a status message to all WebSockets
-			sendWebSocketData(wsMap, statusType, "Error executing SpeedTest.")
+			sendWebSocketData(ctx, statusType, "Error executing SpeedTest.")
+			notifySubscribers(ctx, topicStatus, "Error executing SpeedTest.")
+			ctx.metrics.ObserveFailure(duration)
+			observeAlerts(ctx, messages.PerfJSON{}, err)
+			ctx.setRunning(false)
+			if req.done != nil {
+				req.done <- testOutcome{err: err}
+			}
 			continue
 		}
-		// Add to the perfs array for future reference
-		*perfs = append(*perfs, perf)
+		// Persist the result so history survives a restart
+		if err := ctx.store.Append(toMessagesPerf(perf)); err != nil {
+			logger.Error("Error persisting speedtest result", "test_id", testID, "error", err)
+		}
+		ctx.metrics.ObserveResult(toMessagesPerf(perf), duration)
 		// Marshal the latest value for sending
 		tmpData, err := json.Marshal(perf)
 		if err != nil {
-			log.Println("Error encoding speedtest data.")
+			logger.Error("Error encoding speedtest result", "test_id", testID)
+			ctx.setRunning(false)
+			if req.done != nil {
+				req.done <- testOutcome{err: err}
+			}
 			continue
 		}
 		// Send out the result
-		sendWebSocketData(wsMap, resultType, string(tmpData))
+		sendWebSocketData(ctx, resultType, string(tmpData))
+		notifySubscribers(ctx, topicResult, perf)
+		observeAlerts(ctx, toMessagesPerf(perf), nil)
+		ctx.setRunning(false)
+		if req.done != nil {
+			req.done <- testOutcome{perf: perf}
+		}
 	}
 }
 
-// speedtestTimer initiates a test request at regular intervals.  The interval
-// is defined as "period" number of minutes.
-func speedtestTimer(req chan bool, period int) {
+// speedtestTimer initiates a test request at regular intervals. The initial
+// interval is ctx.period minutes; sending a new value on ctx.periodChan
+// changes the interval at runtime, which is how the netmon.setPeriod RPC
+// method takes effect.
+func speedtestTimer(ctx *HandlerContext) {
+	ctx.setNextRun(time.Now())
+	ctx.reqChan <- testRequest{}
+
+	ticker := time.NewTicker(time.Minute * time.Duration(ctx.period))
+	defer ticker.Stop()
+	ctx.setNextRun(time.Now().Add(time.Minute * time.Duration(ctx.period)))
+
 	for {
-		req <- true
-		time.Sleep(time.Minute * time.Duration(period))
+		select {
+		case <-ticker.C:
+			ctx.reqChan <- testRequest{}
+			ctx.setNextRun(time.Now().Add(time.Minute * time.Duration(ctx.period)))
+		case p := <-ctx.periodChan:
+			ctx.setPeriod(p)
+			ticker.Reset(time.Minute * time.Duration(p))
+			ctx.setNextRun(time.Now().Add(time.Minute * time.Duration(p)))
+		}
+	}
+}
+
+// watchNetwork subscribes to internal/netwatch and broadcasts every
+// interface/address change it reports to all connected WebSockets as a
+// messages.NetEventType Result, as well as to any RPC subscribers of the
+// "netevent" topic. If retest is true, an interface or address change also
+// triggers an immediate speed test via ctx.reqChan.
+func watchNetwork(ctx *HandlerContext, retest bool) {
+	events, err := netwatch.Watch(context.Background())
+	if err != nil {
+		log.Println("Error starting netwatch:", err.Error())
+		return
+	}
+	for ev := range events {
+		netEvent := messages.NetEvent{
+			Iface:     ev.Iface,
+			Kind:      string(ev.Kind),
+			Addr:      ev.Addr,
+			Timestamp: ev.Timestamp,
+		}
+		tmpData, err := json.Marshal(netEvent)
+		if err != nil {
+			log.Println("Error encoding net event.")
+			continue
+		}
+		sendWebSocketData(ctx, messages.NetEventType, string(tmpData))
+		notifySubscribers(ctx, topicNetEvent, netEvent)
+		if retest {
+			ctx.reqChan <- testRequest{}
+		}
 	}
 }
 
@@ -346,18 +658,104 @@ func main() {
 		"If -1 is provided,\nspeedtest-cli will choose the 'best' server.")
 	period := flag.Int("period", 60, "The period (in minutes) between calls to speedtest-cli")
 	addr := flag.String("addr", ":8080", "http service address")
+	engine := flag.String("engine", engineCLI, "The speed test engine to use: "+
+		"'cli' (speedtest-cli) or 'native' (internal/speedtest against a netmon peer)")
+	mode := flag.String("mode", "client", "Native speedtest engine mode: "+
+		"'client' (run tests against -peer), 'server' (only serve as a peer for others), "+
+		"or 'both'")
+	peer := flag.String("peer", "", "Address (host:port) of the netmon peer to use for "+
+		"the native engine, e.g. 'otherhost:7123'")
+	speedtestAddr := flag.String("speedtest-addr", ":7123", "Address the native speed "+
+		"test peer server listens on when -mode is 'server' or 'both'")
+	retestOnLinkChange := flag.Bool("retest-on-link-change", false, "Immediately run a "+
+		"speed test whenever netwatch reports an interface or address change")
+	dbPath := flag.String("db", "netmon.db", "Path to the SQLite database used to store "+
+		"test history. Set to an empty string to keep history in memory only (lost on "+
+		"restart, but still bounded by -retain-raw).")
+	retainRaw := flag.String("retain-raw", "30d", "How long to keep raw samples, e.g. "+
+		"'30d', '72h'. Applies to both the SQLite database and -db \"\"'s in-memory "+
+		"history. 0 disables pruning.")
+	retainHourly := flag.String("retain-hourly", "1y", "How long to keep hourly rollups "+
+		"in the database, e.g. '1y', '720h'. 0 disables pruning. Daily rollups are kept "+
+		"indefinitely.")
+	alertsPath := flag.String("alerts", "", "Path to a YAML or JSON file describing SLA "+
+		"alert rules and notifiers (see internal/alert). Hot-reloaded on SIGHUP. "+
+		"Alerting is disabled if empty.")
+	metricsAddr := flag.String("metrics-addr", "", "If set, bind a separate HTTP server "+
+		"to this address exposing Prometheus metrics at /metrics.")
+	logFormat := flag.String("log-format", "text", "Structured log output format: "+
+		"'text' or 'json'")
 
 	flag.Parse()
 
-	ctx := NewHandlerContext()
+	logger = newLogger(*logFormat)
+
+	retainRawDur, err := parseRetention(*retainRaw)
+	if err != nil {
+		log.Fatal("Error parsing -retain-raw:", err)
+	}
+	retainHourlyDur, err := parseRetention(*retainHourly)
+	if err != nil {
+		log.Fatal("Error parsing -retain-hourly:", err)
+	}
+	st, err := store.Open(*dbPath, retainRawDur, retainHourlyDur)
+	if err != nil {
+		log.Fatal("Error opening history store:", err)
+	}
+
+	alertCfg := alert.Config{}
+	if *alertsPath != "" {
+		alertCfg, err = alert.LoadConfig(*alertsPath)
+		if err != nil {
+			log.Fatal("Error loading -alerts config:", err)
+		}
+	}
+	alertEngine := alert.NewEngine(alertCfg, alert.BuildNotifiers(alertCfg))
+	if *alertsPath != "" {
+		go watchAlertConfigReload(*alertsPath, alertEngine)
+	}
+
+	met := metrics.New()
+	if *metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", met.Handler())
+		fmt.Println("Serving Prometheus metrics on", *metricsAddr)
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, metricsMux))
+		}()
+	}
+
+	if *mode == "server" || *mode == "both" {
+		ln, err := net.Listen("tcp", *speedtestAddr)
+		if err != nil {
+			log.Fatal("Error starting native speedtest peer server:", err)
+		}
+		fmt.Println("Serving native speedtest peer protocol on", *speedtestAddr)
+		go func() {
+			log.Fatal(speedtest.Serve(context.Background(), ln))
+		}()
+	}
+
+	// A mode of "server" means this instance only serves the native peer
+	// protocol; it doesn't run its own tests or web UI.
+	if *mode == "server" {
+		select {}
+	}
+
+	ctx := NewHandlerContext(*server, *engine, *peer, *period, st, alertEngine, met)
 
 	// Run go routine that actually requests data
-	go speedtestHandler(*server, ctx.reqChan, ctx.wsMap, &(ctx.perfs))
+	go speedtestHandler(ctx)
 
 	// provides a request every *period minutes
-	go speedtestTimer(ctx.reqChan, *period)
+	go speedtestTimer(ctx)
+
+	// broadcast interface/address changes and optionally trigger a retest
+	go watchNetwork(ctx, *retestOnLinkChange)
 	// var serverID string
 	http.HandleFunc("/ws", ctx.WsHandler)
+	http.HandleFunc("/rpc", ctx.RPCHandler)
+	http.HandleFunc("/api/history", ctx.HistoryHandler)
 	http.Handle("/", http.FileServer(http.Dir("www")))
 
 	log.Fatal(http.ListenAndServe(*addr, nil))
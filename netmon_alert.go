@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pgrahamdev/netmon/internal/alert"
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// watchAlertConfigReload reloads the -alerts config from path into engine
+// every time netmon receives SIGHUP, so alert rules and notifiers can be
+// edited without restarting the process.
+func watchAlertConfigReload(path string, engine *alert.Engine) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	for range sighup {
+		cfg, err := alert.LoadConfig(path)
+		if err != nil {
+			log.Println("Error reloading -alerts config:", err.Error())
+			continue
+		}
+		engine.Reload(cfg, alert.BuildNotifiers(cfg))
+		log.Println("Reloaded -alerts config from", path)
+	}
+}
+
+// observeAlerts evaluates ctx's alert rules against perf (testErr is
+// non-nil if the test itself failed), logs any notifier delivery errors,
+// and broadcasts every fired alert to WebSocket clients and RPC
+// subscribers.
+func observeAlerts(ctx *HandlerContext, perf messages.PerfJSON, testErr error) {
+	fired, notifyErrs := ctx.alerts.Observe(perf, testErr)
+	for _, err := range notifyErrs {
+		log.Println("Error delivering alert:", err.Error())
+	}
+	for _, a := range fired {
+		broadcastAlert(ctx, a)
+	}
+}
+
+// broadcastAlert sends a as a messages.AlertType Result to all WebSockets
+// and as a JSON-RPC notification to RPC subscribers of topicAlert.
+func broadcastAlert(ctx *HandlerContext, a messages.Alert) {
+	tmpData, err := json.Marshal(a)
+	if err != nil {
+		log.Println("Error encoding alert.")
+		return
+	}
+	sendWebSocketData(ctx, messages.AlertType, string(tmpData))
+	notifySubscribers(ctx, topicAlert, a)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// logger is netmon's structured logger for WebSocket and speed test
+// activity (server_id, client_addr, test_id, ...). main replaces this
+// default with one built by newLogger from the -log-format flag once flags
+// are parsed.
+var logger = newLogger("text")
+
+// newLogger builds the structured logger netmon uses for WebSocket and
+// speed test activity. format selects "json" (slog.JSONHandler) or "text"
+// (slog.TextHandler, the default) output.
+func newLogger(format string) *slog.Logger {
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, nil)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, nil)
+	}
+	return slog.New(handler)
+}
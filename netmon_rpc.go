@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pgrahamdev/netmon/internal/rpc"
+	"github.com/pgrahamdev/netmon/internal/store"
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// Topics that netmon.subscribe/unsubscribe accept, and that notifySubscribers
+// pushes as JSON-RPC notifications.
+const (
+	topicStatus   = "status"
+	topicResult   = "result"
+	topicNetEvent = "netevent"
+	topicAlert    = "alert"
+)
+
+// runTestTimeout bounds how long netmon.runTest waits for a test it
+// triggered to complete before reporting a timeout error.
+const runTestTimeout = 2 * time.Minute
+
+// wsRequest is used to peek at a JSON-RPC frame's method/id before deciding
+// whether it needs the originating *websocket.Conn (netmon.subscribe and
+// netmon.unsubscribe) or can be handled by the connection-agnostic Mux.
+type wsRequest struct {
+	Method string          `json:"method"`
+	ID     json.RawMessage `json:"id,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// dispatchWS handles a JSON-RPC frame received over c. netmon.subscribe and
+// netmon.unsubscribe are handled here directly, since they need to know
+// which connection they came from; everything else is delegated to
+// ctx.mux.
+func (ctx *HandlerContext) dispatchWS(c *websocket.Conn, data []byte) *rpc.Response {
+	var req wsRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &rpc.Response{JSONRPC: rpc.Version, Error: &rpc.Error{Code: rpc.CodeParseError, Message: "Parse error"}}
+	}
+
+	switch req.Method {
+	case "netmon.subscribe", "netmon.unsubscribe":
+		var p subscribeParams
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return &rpc.Response{JSONRPC: rpc.Version, Error: &rpc.Error{Code: rpc.CodeInvalidParams, Message: "Invalid params"}, ID: req.ID}
+		}
+		ctx.mtx.Lock()
+		if ctx.subs[c] == nil {
+			ctx.subs[c] = make(map[string]bool)
+		}
+		for _, topic := range p.Topics {
+			if req.Method == "netmon.subscribe" {
+				ctx.subs[c][topic] = true
+			} else {
+				delete(ctx.subs[c], topic)
+			}
+		}
+		ctx.mtx.Unlock()
+		if len(req.ID) == 0 {
+			return nil
+		}
+		return &rpc.Response{JSONRPC: rpc.Version, Result: p.Topics, ID: req.ID}
+	default:
+		return ctx.mux.Dispatch(data)
+	}
+}
+
+// notifySubscribers sends a JSON-RPC notification for topic to every
+// WebSocket connection subscribed to it.
+func notifySubscribers(ctx *HandlerContext, topic string, params interface{}) {
+	note := rpc.NewNotification(topic, params)
+	ctx.mtx.Lock()
+	defer ctx.mtx.Unlock()
+	for conn, topics := range ctx.subs {
+		if !topics[topic] {
+			continue
+		}
+		if err := conn.WriteJSON(note); err != nil {
+			log.Println("write:", err)
+		}
+	}
+}
+
+// RPCHandler exposes the JSON-RPC 2.0 methods registered on ctx.mux as a
+// plain HTTP endpoint, for callers that would rather POST a request body
+// than hold a WebSocket open. netmon.subscribe and netmon.unsubscribe are
+// handled only over /ws (by dispatchWS); over /rpc they get a "Method not
+// found" error.
+func (ctx *HandlerContext) RPCHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Error reading request body.", http.StatusBadRequest)
+		return
+	}
+
+	resp := ctx.mux.Dispatch(body)
+	w.Header().Set("Content-Type", "application/json")
+	if resp == nil {
+		// A notification (no id) has no response body to send.
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Println("Error encoding RPC response:", err.Error())
+	}
+}
+
+// runTestParams are the parameters accepted by netmon.runTest.
+type runTestParams struct {
+	ServerID *int `json:"serverId,omitempty"`
+}
+
+// listResultsParams are the parameters accepted by netmon.listResults.
+type listResultsParams struct {
+	Since string `json:"since,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// setPeriodParams are the parameters accepted by netmon.setPeriod.
+type setPeriodParams struct {
+	Minutes int `json:"minutes"`
+}
+
+// subscribeParams are the parameters accepted by netmon.subscribe and
+// netmon.unsubscribe.
+type subscribeParams struct {
+	Topics []string `json:"topics"`
+}
+
+// statusResult is the result of netmon.getStatus.
+type statusResult struct {
+	Running bool      `json:"running"`
+	NextRun time.Time `json:"nextRun"`
+	Period  int       `json:"period"`
+}
+
+// buildRPCMux registers netmon's control API methods against ctx and returns
+// the resulting Mux, used by both WsHandler and RPCHandler.
+func (ctx *HandlerContext) buildRPCMux() *rpc.Mux {
+	mux := rpc.NewMux()
+
+	mux.Handle("netmon.runTest", func(raw json.RawMessage) (interface{}, *rpc.Error) {
+		var p runTestParams
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, &rpc.Error{Code: rpc.CodeInvalidParams, Message: "Invalid params"}
+			}
+		}
+		if !ctx.tryBeginTest() {
+			return nil, &rpc.Error{Code: rpc.CodeTestAlreadyRunning, Message: "test already running"}
+		}
+
+		done := make(chan testOutcome, 1)
+		ctx.reqChan <- testRequest{server: p.ServerID, done: done}
+
+		select {
+		case outcome := <-done:
+			if outcome.err != nil {
+				if errors.Is(outcome.err, ErrSpeedtestMissing) {
+					return nil, &rpc.Error{Code: rpc.CodeSpeedtestMissing, Message: "speedtest-cli binary not found"}
+				}
+				return nil, &rpc.Error{Code: rpc.CodeInternalError, Message: "test failed"}
+			}
+			return outcome.perf, nil
+		case <-time.After(runTestTimeout):
+			return nil, &rpc.Error{Code: rpc.CodeInternalError, Message: "test timed out"}
+		}
+	})
+
+	mux.Handle("netmon.listResults", func(raw json.RawMessage) (interface{}, *rpc.Error) {
+		var p listResultsParams
+		if len(raw) > 0 {
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, &rpc.Error{Code: rpc.CodeInvalidParams, Message: "Invalid params"}
+			}
+		}
+		results, err := listResults(ctx.store, p.Since, p.Limit)
+		if err != nil {
+			return nil, &rpc.Error{Code: rpc.CodeInternalError, Message: "Error querying history"}
+		}
+		return results, nil
+	})
+
+	mux.Handle("netmon.getStatus", func(raw json.RawMessage) (interface{}, *rpc.Error) {
+		return ctx.status(), nil
+	})
+
+	mux.Handle("netmon.setPeriod", func(raw json.RawMessage) (interface{}, *rpc.Error) {
+		var p setPeriodParams
+		if err := json.Unmarshal(raw, &p); err != nil || p.Minutes <= 0 {
+			return nil, &rpc.Error{Code: rpc.CodeInvalidParams, Message: "Invalid params"}
+		}
+		ctx.periodChan <- p.Minutes
+		result := ctx.status()
+		result.Period = p.Minutes
+		return result, nil
+	})
+
+	return mux
+}
+
+// listResults returns results recorded after since (an RFC3339 timestamp;
+// all history is considered if since is empty) trimmed to at most the most
+// recent limit entries (no trimming if limit is <= 0).
+func listResults(st store.Store, since string, limit int) ([]messages.PerfJSON, error) {
+	from := time.Time{}
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, err
+		}
+		from = t
+	}
+
+	results, err := st.Query(from, time.Now(), store.Raw)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(results) > limit {
+		results = results[len(results)-limit:]
+	}
+	return results, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pgrahamdev/netmon/internal/store"
+	"github.com/pgrahamdev/netmon/messages"
+)
+
+// parseRetention parses a retention duration like "30d", "1y", or "72h". A
+// bare "0" disables pruning for that retention policy. It extends
+// time.ParseDuration with "d" (24h) and "y" (365 days) suffixes, since
+// those are the natural units for describing how long to keep history.
+func parseRetention(s string) (time.Duration, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	switch {
+	case strings.HasSuffix(s, "d"):
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	case strings.HasSuffix(s, "y"):
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "y"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		return time.Duration(n) * 365 * 24 * time.Hour, nil
+	default:
+		return time.ParseDuration(s)
+	}
+}
+
+// toMessagesPerf converts a main.PerfJSON into a messages.PerfJSON. The two
+// types have identical JSON shapes (messages.PerfJSON exists so
+// netmon-client doesn't need to import the main package), so a JSON
+// round-trip is the simplest faithful conversion.
+func toMessagesPerf(perf PerfJSON) messages.PerfJSON {
+	var out messages.PerfJSON
+	data, err := json.Marshal(perf)
+	if err != nil {
+		return out
+	}
+	json.Unmarshal(data, &out)
+	return out
+}
+
+// HistoryHandler serves /api/history?from=&to=&agg=, returning stored
+// results as JSON. from/to are RFC3339 timestamps (defaulting to 30 days
+// ago and now, respectively) and agg is one of "raw" (default), "hour", or
+// "day".
+func (ctx *HandlerContext) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from := time.Now().Add(-30 * 24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid 'from' timestamp.", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid 'to' timestamp.", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	agg := store.Raw
+	if v := q.Get("agg"); v != "" {
+		agg = store.Aggregation(v)
+	}
+
+	results, err := ctx.store.Query(from, to, agg)
+	if err != nil {
+		log.Println("Error querying history:", err.Error())
+		http.Error(w, "Error querying history.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Println("Error encoding history response:", err.Error())
+	}
+}